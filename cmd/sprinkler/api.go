@@ -0,0 +1,330 @@
+// HTTP control API and Prometheus metrics for the sprinkler daemon.
+//
+// When -listen is set, sprinkler runs as a long-running daemon instead of
+// the traditional one-shot cron-invoked process. The daemon still honors
+// SIGUSR1 for status, but the same information (and control) is available
+// over HTTP so it can be wired into a dashboard or alerting system.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thinkingcow/sprinkler-timer/i2clib"
+)
+
+// daemon holds the state shared between the HTTP handlers and whatever
+// program is currently running on the relay board.
+type daemon struct {
+	ctrl *i2clib.Controller
+
+	mu          sync.Mutex
+	progName    string        // name of the currently configured program
+	prog        program       // the currently configured program
+	activeZone  int           // 0 if nothing is running
+	startedAt   time.Time     // when activeZone was activated
+	remaining   time.Duration // time left on activeZone
+	lastErr     error         // error from the most recent run, if any
+	abort       chan struct{} // closed to cancel the in-progress run, nil if idle
+	zoneRuntime map[int]time.Duration
+	lastRun     map[int]time.Time
+	i2cErrors   int64
+}
+
+func newDaemon(ctrl *i2clib.Controller, progName string, prog program) *daemon {
+	return &daemon{
+		ctrl:        ctrl,
+		progName:    progName,
+		prog:        prog,
+		zoneRuntime: make(map[int]time.Duration),
+		lastRun:     make(map[int]time.Time),
+	}
+}
+
+// setActive records that zone is now running for dur, or clears the active
+// zone when id is 0.
+func (d *daemon) setActive(id int, dur time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id == 0 {
+		d.activeZone = 0
+		d.remaining = 0
+		return
+	}
+	d.activeZone = id
+	d.startedAt = time.Now()
+	d.remaining = dur
+}
+
+func (d *daemon) recordRun(id int, ran time.Duration, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.zoneRuntime[id] += ran
+	d.lastRun[id] = time.Now()
+	if err != nil {
+		d.i2cErrors++
+		d.lastErr = err
+	}
+}
+
+// startRun claims the daemon for a single run, so at most one zone or
+// program is ever active at a time. It reports false if a run is already
+// in progress.
+func (d *daemon) startRun() (abort chan struct{}, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.abort != nil {
+		return nil, false
+	}
+	d.abort = make(chan struct{})
+	return d.abort, true
+}
+
+// finishRun releases the claim taken by startRun.
+func (d *daemon) finishRun() {
+	d.mu.Lock()
+	d.abort = nil
+	d.mu.Unlock()
+}
+
+// runZone activates a single zone for dur, scaled by pct, honoring abort.
+// The caller must hold the run claimed by startRun.
+func (d *daemon) runZone(abort chan struct{}, id int, dur time.Duration, pct int) error {
+	scaled := scale(dur, pct)
+	d.setActive(id, scaled)
+	defer d.setActive(0, 0)
+
+	if err := d.ctrl.Set(id, true); err != nil {
+		d.recordRun(id, 0, err)
+		return err
+	}
+	start := time.Now()
+	select {
+	case <-time.After(scaled):
+	case <-abort:
+	}
+	off := d.ctrl.Set(id, false)
+	d.recordRun(id, time.Since(start), off)
+	return off
+}
+
+// runProgram runs p to completion, or until aborted, updating metrics as it
+// goes. The caller must hold the run claimed by startRun.
+func (d *daemon) runProgram(abort chan struct{}, p program, pct int) error {
+	for _, e := range p {
+		if e.id == 0 {
+			// A "0" event is a pause: no zone is activated.
+			select {
+			case <-time.After(scale(e.dur, pct)):
+			case <-abort:
+				return nil
+			}
+		} else if err := d.runZone(abort, e.id, e.dur, pct); err != nil {
+			return err
+		}
+		select {
+		case <-abort:
+			return nil
+		default:
+		}
+		time.Sleep(offTime)
+	}
+	return nil
+}
+
+// abortRun cancels the run in progress, if any.
+func (d *daemon) abortRun() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.abort == nil {
+		return false
+	}
+	close(d.abort)
+	return true
+}
+
+type statusResp struct {
+	ActiveZone  int           `json:"active_zone"`
+	Remaining   time.Duration `json:"remaining_ns"`
+	LastError   string        `json:"last_error,omitempty"`
+	ProgramName string        `json:"program_name"`
+}
+
+func (d *daemon) status() statusResp {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := statusResp{ActiveZone: d.activeZone, ProgramName: d.progName}
+	if d.activeZone != 0 {
+		elapsed := time.Since(d.startedAt)
+		if elapsed < d.remaining {
+			s.Remaining = d.remaining - elapsed
+		}
+	}
+	if d.lastErr != nil {
+		s.LastError = d.lastErr.Error()
+	}
+	return s
+}
+
+func (d *daemon) handleStatus(w http.ResponseWriter, req *http.Request) {
+	json.NewEncoder(w).Encode(d.status())
+}
+
+func (d *daemon) handleZones(w http.ResponseWriter, req *http.Request) {
+	zone := strings.TrimPrefix(req.URL.Path, "/zones/")
+	if zone == "" || zone == req.URL.Path {
+		// GET /zones: report currently active zones.
+		json.NewEncoder(w).Encode(map[string][]int{"active": d.ctrl.Active()})
+		return
+	}
+	id, err := d.ctrl.Resolve(zone)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		Duration time.Duration `json:"duration"`
+		Scale    int           `json:"scale"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Scale == 0 {
+		body.Scale = 100
+	}
+	abort, ok := d.startRun()
+	if !ok {
+		http.Error(w, "a zone or program is already running", http.StatusConflict)
+		return
+	}
+	go func() {
+		defer d.finishRun()
+		d.runZone(abort, id, body.Duration, body.Scale)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (d *daemon) handleProgramRun(name string, w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	d.mu.Lock()
+	if name != d.progName {
+		d.mu.Unlock()
+		http.Error(w, fmt.Sprintf("unknown program %q", name), http.StatusNotFound)
+		return
+	}
+	prog := d.prog
+	d.mu.Unlock()
+	pct := 100
+	if v := req.URL.Query().Get("scale"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			pct = n
+		}
+	}
+	abort, ok := d.startRun()
+	if !ok {
+		http.Error(w, "a zone or program is already running", http.StatusConflict)
+		return
+	}
+	go func() {
+		defer d.finishRun()
+		d.runProgram(abort, prog, pct)
+	}()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (d *daemon) handleProgramAbort(name string, w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if d.abortRun() {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	http.Error(w, "nothing running", http.StatusConflict)
+}
+
+func (d *daemon) handlePrograms(w http.ResponseWriter, req *http.Request) {
+	rest := strings.TrimPrefix(req.URL.Path, "/programs/")
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 {
+		http.Error(w, "expecting /programs/{name}/run|abort", http.StatusNotFound)
+		return
+	}
+	switch parts[1] {
+	case "run":
+		d.handleProgramRun(parts[0], w, req)
+	case "abort":
+		d.handleProgramAbort(parts[0], w, req)
+	default:
+		http.Error(w, fmt.Sprintf("unknown action %q", parts[1]), http.StatusNotFound)
+	}
+}
+
+// handleMetrics renders counters and gauges in Prometheus text exposition format.
+func (d *daemon) handleMetrics(w http.ResponseWriter, req *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP sprinkler_zone_runtime_seconds_total Total time a zone has been activated.")
+	fmt.Fprintln(w, "# TYPE sprinkler_zone_runtime_seconds_total counter")
+	for zone, dur := range d.zoneRuntime {
+		fmt.Fprintf(w, "sprinkler_zone_runtime_seconds_total{zone=\"%d\"} %f\n", zone, dur.Seconds())
+	}
+
+	fmt.Fprintln(w, "# HELP sprinkler_active_zone Zone currently activated, 0 if none.")
+	fmt.Fprintln(w, "# TYPE sprinkler_active_zone gauge")
+	fmt.Fprintf(w, "sprinkler_active_zone %d\n", d.activeZone)
+
+	fmt.Fprintln(w, "# HELP sprinkler_i2c_errors_total Number of i2c read/write errors encountered.")
+	fmt.Fprintln(w, "# TYPE sprinkler_i2c_errors_total counter")
+	fmt.Fprintf(w, "sprinkler_i2c_errors_total %d\n", d.i2cErrors)
+
+	fmt.Fprintln(w, "# HELP sprinkler_zone_last_run_timestamp_seconds Unix time of the last run per zone, whether it completed, was aborted or failed.")
+	fmt.Fprintln(w, "# TYPE sprinkler_zone_last_run_timestamp_seconds gauge")
+	for zone, t := range d.lastRun {
+		fmt.Fprintf(w, "sprinkler_zone_last_run_timestamp_seconds{zone=\"%d\"} %d\n", zone, t.Unix())
+	}
+}
+
+// serve starts the HTTP control API and blocks until the server exits.
+func (d *daemon) serve(addr string) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", d.handleStatus)
+	mux.HandleFunc("/zones", d.handleZones)
+	mux.HandleFunc("/zones/", d.handleZones)
+	mux.HandleFunc("/programs/", d.handlePrograms)
+	mux.HandleFunc("/metrics", d.handleMetrics)
+
+	l, activated, err := listenerFromEnv()
+	if err != nil {
+		return err
+	}
+	if !activated {
+		l, err = net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	stopWatchdog := make(chan struct{})
+	defer close(stopWatchdog)
+	go watchdogLoop(stopWatchdog)
+	sdNotify("READY=1")
+
+	return http.Serve(l, mux)
+}
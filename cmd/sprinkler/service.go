@@ -0,0 +1,132 @@
+// `sprinkler service install` generates and installs a service-manager
+// unit for this binary, whether the host runs systemd or an OpenRC-based
+// distro. It writes the unit and prints the command that enables it; it
+// does not enable or start the service itself.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// serviceManager writes whatever unit/script a given init system needs to
+// run this binary as a service, in its own format and location.
+type serviceManager interface {
+	// Install writes the unit for name, running execStart (already a full
+	// command line, e.g. "/usr/local/bin/sprinkler -config ...").
+	// It reports the path written so the caller can tell the user how to
+	// enable it.
+	Install(name, execStart string) (path string, err error)
+}
+
+type systemdManager struct{ dir string } // e.g. /etc/systemd/system
+
+func (m systemdManager) Install(name, execStart string) (string, error) {
+	unit := fmt.Sprintf(`[Unit]
+Description=sprinkler-timer (%s)
+After=network.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+WatchdogSec=30
+
+[Install]
+WantedBy=multi-user.target
+`, name, execStart)
+	path := filepath.Join(m.dir, name+".service")
+	if err := os.WriteFile(path, []byte(unit), 0644); err != nil {
+		return "", fmt.Errorf("can't write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+type openrcManager struct{ dir string } // e.g. /etc/init.d
+
+func (m openrcManager) Install(name, execStart string) (string, error) {
+	fields := strings.Fields(execStart)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("-exec-start is empty")
+	}
+	script := fmt.Sprintf(`#!/sbin/openrc-run
+description="sprinkler-timer (%s)"
+command=%q
+command_args=%q
+command_background=true
+pidfile="/run/%s.pid"
+
+depend() {
+	need net
+}
+`, name, fields[0], strings.Join(fields[1:], " "), name)
+	path := filepath.Join(m.dir, name)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		return "", fmt.Errorf("can't write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// detectServiceManager picks systemd if "systemctl" is on PATH, else
+// OpenRC if "rc-service" is, else reports that neither was found.
+func detectServiceManager() (serviceManager, error) {
+	if _, err := exec.LookPath("systemctl"); err == nil {
+		return systemdManager{dir: "/etc/systemd/system"}, nil
+	}
+	if _, err := exec.LookPath("rc-service"); err == nil {
+		return openrcManager{dir: "/etc/init.d"}, nil
+	}
+	return nil, fmt.Errorf("no supported service manager found (looked for systemctl, rc-service); pass -manager to override detection")
+}
+
+// runServiceCmd implements the "sprinkler service ..." subcommand family.
+func runServiceCmd(args []string) {
+	if len(args) < 1 || args[0] != "install" {
+		fmt.Fprintln(os.Stderr, "Usage: sprinkler service install [options]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("service install", flag.ExitOnError)
+	name := fs.String("name", "sprinkler", "service name to install as")
+	manager := fs.String("manager", "auto", "service manager: auto, systemd, or openrc")
+	execStart := fs.String("exec-start", "", "full command line to run, e.g. '/usr/local/bin/sprinkler -config /etc/sprinkler/programs.json'")
+	fs.Parse(args[1:])
+
+	if *execStart == "" {
+		fmt.Fprintln(os.Stderr, "-exec-start is required")
+		os.Exit(2)
+	}
+
+	var mgr serviceManager
+	var err error
+	switch *manager {
+	case "auto":
+		mgr, err = detectServiceManager()
+	case "systemd":
+		mgr = systemdManager{dir: "/etc/systemd/system"}
+	case "openrc":
+		mgr = openrcManager{dir: "/etc/init.d"}
+	default:
+		err = fmt.Errorf("unknown -manager %q", *manager)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	path, err := mgr.Install(*name, *execStart)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Printf("Installed %s\n", path)
+	switch mgr.(type) {
+	case systemdManager:
+		fmt.Printf("Enable with: systemctl enable --now %s\n", *name)
+	case openrcManager:
+		fmt.Printf("Enable with: rc-update add %s default && rc-service %s start\n", *name, *name)
+	}
+}
@@ -3,7 +3,8 @@
 //   A "program" is a set of sprinkler zones that run in a sequence, each for a specified duration.
 //   This cli defines and runs a "program"
 //   One or more instances are intended to be started via cron.
-//   Only one relay (sprinkler zone) should be activated at a time.
+//   Zones are resolved through an i2clib.Controller, whose Policy (serial by
+//   default) governs how many may be active at once.
 package main
 
 import (
@@ -11,29 +12,32 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/thinkingcow/sprinkler-timer/i2clib"
+	"github.com/thinkingcow/sprinkler-timer/scheduler"
 )
 
 //  Wait a bit between sprinkler zone activations
 var offTime time.Duration = time.Second * 3
 
-// An event is a sprinker zone number and watering duration
+// An event is a sprinker zone and watering duration
 type event struct {
-	id  int           // sprinker number, 0 for none
-	dur time.Duration // time duration
+	id    int           // zone number, resolved from token by resolveZones; 0 for none
+	token string        // zone number or name as given on -program, awaiting resolveZones
+	dur   time.Duration // time duration
 }
 
 // Implement the flag.Value interface
 
 func (e *event) String() string {
-	return fmt.Sprintf("%d:%s", e.id, e.dur.String())
+	return fmt.Sprintf("%s:%s", e.token, e.dur.String())
 }
 
+// Set parses "n:t", where n is a zone number or name resolved later by
+// resolveZones, once the Controller is built.
 func (e *event) Set(s string) error {
 	parts := strings.Split(s, ":")
 	if len(parts) != 2 {
@@ -46,29 +50,25 @@ func (e *event) Set(s string) error {
 	if dur < offTime {
 		return fmt.Errorf("Invalid duration %s: Must be at least %v", dur, offTime)
 	}
-	id, err := strconv.Atoi(parts[0])
-	if err != nil || id < 0 {
-		return fmt.Errorf("Invalid id %q: %w", parts[0], err)
-	}
+	e.token = parts[0]
 	e.dur = dur
-	e.id = id
 	return nil
 }
 
 // Run activates the sprinkler, scaling the run time by pct.
-func (e *event) run(r *i2clib.Relay, pct int) error {
-	var mask int
+func (e *event) run(ctrl *i2clib.Controller, pct int) error {
 	if e.id > 0 {
-		mask = 1 << (e.id - 1)
-	}
-	if err := r.Set(mask); err != nil {
-		return err
+		if err := ctrl.Set(e.id, true); err != nil {
+			return err
+		}
 	}
 	dur := scale(e.dur, pct)
 	fmt.Fprintf(os.Stderr, "set %d for %s\n", e.id, dur)
 	time.Sleep(dur)
 	fmt.Fprintf(os.Stderr, "set %d off\n", e.id)
-	r.Set(0)
+	if e.id > 0 {
+		ctrl.Set(e.id, false)
+	}
 	time.Sleep(offTime)
 	return nil
 }
@@ -95,6 +95,23 @@ func (p *program) Set(s string) error {
 	return nil
 }
 
+// resolveZones fills in e.id for every event from its token, via ctrl. The
+// literal token "0" means no zone and resolves to id 0 without consulting
+// ctrl, preserving that as a deliberate no-op/pause event.
+func (p *program) resolveZones(ctrl *i2clib.Controller) error {
+	for i, e := range *p {
+		if e.token == "0" {
+			continue
+		}
+		id, err := ctrl.Resolve(e.token)
+		if err != nil {
+			return err
+		}
+		(*p)[i].id = id
+	}
+	return nil
+}
+
 // duration computes the total run time of a program sequence.
 func (p *program) duration(pct int) time.Duration {
 	var total time.Duration
@@ -104,10 +121,19 @@ func (p *program) duration(pct int) time.Duration {
 	return total + time.Duration(int64(len(*p))*int64(offTime))
 }
 
-// run the sequence.
-func (p *program) run(r *i2clib.Relay, pct int) error {
+// run the sequence, consulting wp before each zone activation to skip or
+// scale it down for rain. wp may be nil to disable rain-skip entirely. With
+// pct 0 (the -scale testing mode) wp is not consulted and every zone runs.
+func (p *program) run(ctrl *i2clib.Controller, pct int, wp *weatherPolicy) error {
 	for _, e := range *p {
-		if err := e.run(r, pct); err != nil {
+		zonePct := pct
+		if pct > 0 {
+			zonePct = wp.adjust(e.id, pct)
+			if zonePct <= 0 {
+				continue
+			}
+		}
+		if err := e.run(ctrl, zonePct); err != nil {
 			return err
 		}
 	}
@@ -124,48 +150,80 @@ func scale(dur time.Duration, percent int) time.Duration {
 }
 
 // Ensure all sprinklers are off if the program is terminated.
-// signal USR1 can be used to query the existing sprinkler state.
-func cleanup(r *i2clib.Relay) {
+// signal USR1 can be used to query the existing sprinkler state. SIGHUP is
+// deliberately not registered here: in -config mode it's the scheduler's
+// hot-reload trigger, and this handler must not race it for ownership of
+// the signal (or kill the daemon outright).
+func cleanup(ctrl *i2clib.Controller) {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM, syscall.SIGUSR1)
 	go func() {
 		for {
 			s := <-c
-			if s == syscall.SIGURG {
-				continue // Go uses this internally
-			}
 			fmt.Fprintf(os.Stderr, "\nGot signal %s\n", s)
 			if s == syscall.SIGUSR1 {
-				i, _ := r.Get()
-				fmt.Fprintf(os.Stderr, "state=0x%x\n", i)
+				fmt.Fprintf(os.Stderr, "active zones=%v\n", ctrl.Active())
 				continue
 			}
-			r.Set(0)
-			r.Close()
+			sdNotify("STOPPING=1")
+			ctrl.AllOff()
+			ctrl.Close()
 			os.Exit(0)
 		}
 	}()
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "service" {
+		runServiceCmd(os.Args[2:])
+		return
+	}
+
 	var board int
 	var bus int
 	var scale int
 	var isDuration bool
 	var prog program
-	flag.Var(&prog, "program", "comma-separated list of zone_number:duration")
+	var listen string
+	var progName string
+	var configPath string
+	var journalPath string
+	var weatherURL string
+	var weatherKey string
+	var rainThresholdMM float64
+	var skipHours int
+	var zoneMapPath string
+	var policyName string
+	var maxConcurrent int
+	var powerBudgetWatts int
+	var zoneWattsPath string
+	flag.Var(&prog, "program", "comma-separated list of zone_number_or_name:duration")
 	flag.IntVar(&board, "board", 1, "relay board number (1-8)")
 	flag.IntVar(&bus, "i2c-bus", 1, "i2c bus number")
 	flag.IntVar(&scale, "scale", 100, "scale all times by this value (use 0 for testing)")
 	flag.BoolVar(&isDuration, "total-time", false, "Compute total duration of entire program")
+	flag.StringVar(&listen, "listen", "", "if set, run as a daemon and serve the control API on this address (e.g. :8080) instead of running once and exiting")
+	flag.StringVar(&progName, "name", "default", "name this program is addressable as under /programs/{name} when -listen is set")
+	flag.StringVar(&configPath, "config", "", "if set, run the scheduler against this program definition file instead of running -program once and exiting; replaces per-program cron entries")
+	flag.StringVar(&journalPath, "journal", "/var/lib/sprinkler/journal.json", "path to the scheduler's run-state journal, used with -config")
+	flag.StringVar(&weatherURL, "weather-url", "", "if set, consult this forecast URL before each zone and skip or scale it down for rain")
+	flag.StringVar(&weatherKey, "weather-key", "", "API key appended to -weather-url as appid")
+	flag.Float64Var(&rainThresholdMM, "rain-threshold-mm", 6, "skip a zone once forecast+recent rain reaches this many mm, used with -weather-url")
+	flag.IntVar(&skipHours, "skip-hours", 24, "how many hours of forecast rain to consider, used with -weather-url")
+	flag.StringVar(&zoneMapPath, "zone-map", "", "path to a JSON file mapping virtual zones to names and (bus,board,relay), for installations with more than one relay board; if unset, zone N is relay N (1-8) on -i2c-bus/-board")
+	flag.StringVar(&policyName, "policy", "serial", "how many zones the Controller allows active at once: serial, max-concurrent, or power-budget")
+	flag.IntVar(&maxConcurrent, "max-concurrent", 1, "zones allowed active at once, used with -policy=max-concurrent")
+	flag.IntVar(&powerBudgetWatts, "power-budget-watts", 0, "total watts allowed active at once, used with -policy=power-budget")
+	flag.StringVar(&zoneWattsPath, "zone-watts", "", "path to a JSON file of per-zone watt draw (e.g. {\"watts\":{\"1\":500},\"default_watts\":300}), used with -policy=power-budget")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s service install -exec-start '...' [options]\n", os.Args[0])
 		fmt.Fprintf(os.Stderr, "  Use 'kill -USR1 $pid' to see currently active zone, if any\n")
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if len(prog) < 1 {
+	if configPath == "" && len(prog) < 1 {
 		fmt.Fprintln(os.Stderr, "No program specified")
 		flag.Usage()
 		return
@@ -174,23 +232,62 @@ func main() {
 		fmt.Println(prog.duration(scale).String())
 		return
 	}
-	r, err := i2clib.NewRelay(bus, board)
+
+	policy, err := buildPolicy(policyName, maxConcurrent, powerBudgetWatts, zoneWattsPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Can't find board %d on bus %d: %s\n", board, bus, err)
+		fmt.Fprintf(os.Stderr, "%s\n", err)
 		return
 	}
-	i, err := r.Get()
+	ctrl, err := buildController(policy, bus, board, zoneMapPath)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Can't talk to relays: %s\n", err)
+		fmt.Fprintf(os.Stderr, "Can't build zone controller: %s\n", err)
+		return
+	}
+	if err := prog.resolveZones(ctrl); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	if err := ctrl.CheckIdle(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	cleanup(ctrl)
+	defer ctrl.Close()
+
+	if configPath != "" {
+		sch, err := scheduler.New(ctrl, configPath, journalPath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Can't load %s: %s\n", configPath, err)
+			return
+		}
+		stopWatchdog := make(chan struct{})
+		defer close(stopWatchdog)
+		go watchdogLoop(stopWatchdog)
+		sdNotify("READY=1")
+		if err := sch.Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Scheduler failed: %s\n", err)
+		}
 		return
 	}
-	if i != 0 {
-		fmt.Fprintf(os.Stderr, "Relays already in use! (mask=0x%02x)\n", i)
+
+	if listen != "" {
+		d := newDaemon(ctrl, progName, prog)
+		fmt.Fprintf(os.Stderr, "serving control API on %s\n", listen)
+		if err := d.serve(listen); err != nil {
+			fmt.Fprintf(os.Stderr, "HTTP server failed: %s\n", err)
+		}
 		return
 	}
-	cleanup(r)
-	defer r.Close()
-	if err := prog.run(r, scale); err != nil {
+
+	var wp *weatherPolicy
+	if weatherURL != "" {
+		wp = &weatherPolicy{
+			provider:    newHTTPWeatherProvider(weatherURL, weatherKey),
+			thresholdMM: rainThresholdMM,
+			skipHours:   skipHours,
+		}
+	}
+	if err := prog.run(ctrl, scale, wp); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed: %s\n", err)
 	}
 }
@@ -0,0 +1,70 @@
+// Socket activation and sd_notify support, so sprinkler can run as a
+// systemd service: systemd opens the control API's listening socket and
+// passes it down via LISTEN_FDS, and sprinkler reports readiness, a
+// watchdog heartbeat, and shutdown back to systemd over NOTIFY_SOCKET.
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const sdListenFDsStart = 3 // SD_LISTEN_FDS_START, see sd_listen_fds(3)
+
+// listenerFromEnv adopts the file descriptor systemd passed via socket
+// activation, if any, rather than opening a new listener. ok is false if
+// no socket was handed down, in which case the caller should open its own.
+func listenerFromEnv() (l net.Listener, ok bool, err error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	nfds, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if pid != os.Getpid() || nfds < 1 {
+		return nil, false, nil
+	}
+	f := os.NewFile(uintptr(sdListenFDsStart), "LISTEN_FD_3")
+	l, err = net.FileListener(f)
+	if err != nil {
+		return nil, false, fmt.Errorf("can't use socket-activated fd: %w", err)
+	}
+	f.Close() // net.FileListener dup()s the fd, so this one is no longer needed
+	return l, true, nil
+}
+
+// sdNotify sends state (e.g. "READY=1", "STOPPING=1", "WATCHDOG=1") to
+// systemd's notification socket. It is a silent no-op if NOTIFY_SOCKET
+// isn't set, i.e. when not running under systemd.
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		return fmt.Errorf("can't reach NOTIFY_SOCKET: %w", err)
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogLoop pings systemd's watchdog, if WATCHDOG_USEC is set, at half
+// the requested interval, for as long as stop is open.
+func watchdogLoop(stop <-chan struct{}) {
+	usec, _ := strconv.Atoi(os.Getenv("WATCHDOG_USEC"))
+	if usec <= 0 {
+		return
+	}
+	interval := time.Duration(usec) * time.Microsecond / 2
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			sdNotify("WATCHDOG=1")
+		case <-stop:
+			return
+		}
+	}
+}
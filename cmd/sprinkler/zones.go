@@ -0,0 +1,122 @@
+// Zone-map and Policy configuration for the i2clib.Controller this CLI
+// runs against: which physical (bus, board, relay) each virtual zone is,
+// what name it's addressable by, and how many zones its Policy lets run
+// at once.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/thinkingcow/sprinkler-timer/i2clib"
+)
+
+// zoneMapEntry maps one virtual zone to its name and physical location.
+type zoneMapEntry struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Bus   int    `json:"bus"`
+	Board int    `json:"board"`
+	Relay int    `json:"relay"`
+}
+
+// zoneMapConfig is the top-level -zone-map file: the zones of a
+// multi-board installation, in place of the single (-i2c-bus, -board)
+// pair used by a single-board setup.
+type zoneMapConfig struct {
+	Zones []zoneMapEntry `json:"zones"`
+}
+
+// loadZoneMap reads and parses a -zone-map file.
+func loadZoneMap(path string) (*zoneMapConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read zone map %s: %w", path, err)
+	}
+	var c zoneMapConfig
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("can't parse zone map %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// buildPolicy returns the Policy named by policyName, consulting
+// maxConcurrent or powerBudgetWatts/zoneWattsPath as needed.
+func buildPolicy(policyName string, maxConcurrent int, powerBudgetWatts int, zoneWattsPath string) (i2clib.Policy, error) {
+	switch policyName {
+	case "serial":
+		return i2clib.SerialPolicy{}, nil
+	case "max-concurrent":
+		if maxConcurrent < 1 {
+			return nil, fmt.Errorf("-max-concurrent must be at least 1 for -policy=max-concurrent")
+		}
+		return i2clib.MaxConcurrent(maxConcurrent), nil
+	case "power-budget":
+		if powerBudgetWatts < 1 {
+			return nil, fmt.Errorf("-power-budget-watts must be at least 1 for -policy=power-budget")
+		}
+		watts := make(map[int]int)
+		defaultWatts := 0
+		if zoneWattsPath != "" {
+			data, err := os.ReadFile(zoneWattsPath)
+			if err != nil {
+				return nil, fmt.Errorf("can't read -zone-watts %s: %w", zoneWattsPath, err)
+			}
+			var zw struct {
+				Watts        map[string]int `json:"watts"`
+				DefaultWatts int            `json:"default_watts"`
+			}
+			if err := json.Unmarshal(data, &zw); err != nil {
+				return nil, fmt.Errorf("can't parse -zone-watts %s: %w", zoneWattsPath, err)
+			}
+			for k, v := range zw.Watts {
+				var zone int
+				if _, err := fmt.Sscanf(k, "%d", &zone); err != nil {
+					return nil, fmt.Errorf("-zone-watts %s: invalid zone %q", zoneWattsPath, k)
+				}
+				watts[zone] = v
+			}
+			defaultWatts = zw.DefaultWatts
+		}
+		return i2clib.PowerBudgetPolicy{BudgetWatts: powerBudgetWatts, Watts: watts, DefaultWatts: defaultWatts}, nil
+	default:
+		return nil, fmt.Errorf("unknown -policy %q: expecting serial, max-concurrent, or power-budget", policyName)
+	}
+}
+
+// buildController returns a Controller enforcing policy. With no
+// zoneMapPath, it falls back to the original single-board behavior: zone N
+// maps to relay N (1-8) on (bus, board). With zoneMapPath set, it adds
+// every board referenced in the file and maps each zone as configured,
+// ignoring bus and board.
+func buildController(policy i2clib.Policy, bus, board int, zoneMapPath string) (*i2clib.Controller, error) {
+	ctrl := i2clib.NewController(policy)
+	if zoneMapPath == "" {
+		if err := ctrl.AddBoard(bus, board); err != nil {
+			return nil, err
+		}
+		for relay := 1; relay <= 8; relay++ {
+			if err := ctrl.MapZone(relay, "", bus, board, relay); err != nil {
+				return nil, err
+			}
+		}
+		return ctrl, nil
+	}
+
+	zm, err := loadZoneMap(zoneMapPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, z := range zm.Zones {
+		if err := ctrl.AddBoard(z.Bus, z.Board); err != nil {
+			return nil, err
+		}
+	}
+	for _, z := range zm.Zones {
+		if err := ctrl.MapZone(z.ID, z.Name, z.Bus, z.Board, z.Relay); err != nil {
+			return nil, err
+		}
+	}
+	return ctrl, nil
+}
@@ -0,0 +1,30 @@
+package i2clib
+
+// relay2icTable and ic2relayTable are 256-entry lookup tables, one entry
+// per possible 8-zone bit mask, built once from relay2Addr/addr2Relay so
+// the common case is a single load instead of an 8-iteration bit loop.
+var relay2icTable = buildTable(relay2Addr)
+var ic2relayTable = buildTable(addr2Relay)
+
+// buildTable computes, for every possible input byte, the byte produced by
+// applying permutation perm bit-by-bit (perm[i] is the destination bit for
+// source bit i).
+func buildTable(perm []byte) [256]byte {
+	var t [256]byte
+	for m := 0; m < 256; m++ {
+		var v byte
+		for i := 0; i < 8; i++ {
+			if m&(1<<i) != 0 {
+				v |= 1 << perm[i]
+			}
+		}
+		t[m] = v
+	}
+	return t
+}
+
+// relay2icFunc and ic2relayFunc do the actual bit permutation. They default
+// to the lookup tables above and are overridden at init time on amd64 when
+// the CPU has BMI2 (see relay_amd64.go).
+var relay2icFunc = func(in byte) byte { return relay2icTable[in] }
+var ic2relayFunc = func(in byte) byte { return ic2relayTable[in] }
@@ -0,0 +1,265 @@
+package i2clib
+
+import (
+	"fmt"
+	"sync"
+)
+
+// board identifies a relay board by bus and board address.
+type board struct {
+	bus, board int
+}
+
+// ZoneID is the physical location of a virtual zone: which bus, which
+// board on that bus, and which relay (1-8) on that board.
+type ZoneID struct {
+	Bus   int
+	Board int
+	Relay int
+}
+
+// Policy decides whether a zone may be activated given the zones already
+// active. It lets installations larger than "one relay at a time" share
+// the same event-runner logic as the original single-board CLI.
+type Policy interface {
+	// Allow returns an error if zone must not be activated while the zones
+	// in active are already on.
+	Allow(zone int, active map[int]bool) error
+}
+
+// SerialPolicy is the original sprinkler behavior: only one zone may be
+// active at any time.
+type SerialPolicy struct{}
+
+func (SerialPolicy) Allow(zone int, active map[int]bool) error {
+	for z := range active {
+		if z != zone {
+			return fmt.Errorf("zone %d is already active, only one zone may run at a time under SerialPolicy", z)
+		}
+	}
+	return nil
+}
+
+// MaxConcurrent allows up to N zones to be active simultaneously.
+type MaxConcurrent int
+
+func (m MaxConcurrent) Allow(zone int, active map[int]bool) error {
+	if _, ok := active[zone]; ok {
+		return nil
+	}
+	if len(active) >= int(m) {
+		return fmt.Errorf("%d zones already active, MaxConcurrent is %d", len(active), int(m))
+	}
+	return nil
+}
+
+// PowerBudgetPolicy limits the total draw, in watts, of simultaneously
+// active zones. DefaultWatts is used for any zone not listed in Watts.
+type PowerBudgetPolicy struct {
+	BudgetWatts  int
+	Watts        map[int]int
+	DefaultWatts int
+}
+
+func (p PowerBudgetPolicy) draw(zone int) int {
+	if w, ok := p.Watts[zone]; ok {
+		return w
+	}
+	return p.DefaultWatts
+}
+
+func (p PowerBudgetPolicy) Allow(zone int, active map[int]bool) error {
+	total := p.draw(zone)
+	for z := range active {
+		if z != zone {
+			total += p.draw(z)
+		}
+	}
+	if total > p.BudgetWatts {
+		return fmt.Errorf("activating zone %d would draw %dW, over the %dW budget", zone, total, p.BudgetWatts)
+	}
+	return nil
+}
+
+// Controller wraps one or more relay boards, possibly on different i2c
+// buses, behind a single virtual zone address space (1-64, 8 boards of 8
+// relays each) with human-readable names and a pluggable Policy governing
+// which zones may be active at once.
+type Controller struct {
+	policy Policy
+
+	mu     sync.Mutex
+	boards map[board]*Relay
+	zones  map[int]ZoneID
+	names  map[string]int
+	active map[int]bool
+}
+
+// NewController returns a Controller enforcing policy. Boards and zones
+// are added with AddBoard and MapZone before use.
+func NewController(policy Policy) *Controller {
+	return &Controller{
+		policy: policy,
+		boards: make(map[board]*Relay),
+		zones:  make(map[int]ZoneID),
+		names:  make(map[string]int),
+		active: make(map[int]bool),
+	}
+}
+
+// AddBoard opens the relay board at (bus, board) so zones can be mapped
+// onto it. It is a no-op if that board was already added.
+func (c *Controller) AddBoard(bus, boardNum int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := board{bus: bus, board: boardNum}
+	if _, ok := c.boards[key]; ok {
+		return nil
+	}
+	r, err := NewRelay(bus, boardNum)
+	if err != nil {
+		return err
+	}
+	c.boards[key] = r
+	return nil
+}
+
+// MapZone assigns virtual zone number zone (1-64) and the human-readable
+// name to the physical relay (bus, boardNum, relay). AddBoard must have
+// been called for (bus, boardNum) first.
+func (c *Controller) MapZone(zone int, name string, bus, boardNum, relay int) error {
+	if zone < 1 || zone > 64 {
+		return fmt.Errorf("invalid zone %d: must be 1-64", zone)
+	}
+	if relay < 1 || relay > 8 {
+		return fmt.Errorf("invalid relay %d: must be 1-8", relay)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := board{bus: bus, board: boardNum}
+	if _, ok := c.boards[key]; !ok {
+		return fmt.Errorf("board bus=%d board=%d not added", bus, boardNum)
+	}
+	c.zones[zone] = ZoneID{Bus: bus, Board: boardNum, Relay: relay}
+	if name != "" {
+		c.names[name] = zone
+	}
+	return nil
+}
+
+// Resolve turns a zone number or mapped name into a virtual zone number.
+func (c *Controller) Resolve(s string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if zone, ok := c.names[s]; ok {
+		return zone, nil
+	}
+	var zone int
+	if _, err := fmt.Sscanf(s, "%d", &zone); err == nil {
+		if _, ok := c.zones[zone]; ok {
+			return zone, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown zone %q", s)
+}
+
+// Set activates zone, subject to the Controller's Policy, or deactivates it
+// if on is false. Boards are shared: activating or deactivating one zone
+// recomputes the whole relay mask for its board from every zone on that
+// board that's currently active, so two zones on the same board don't
+// clobber each other.
+func (c *Controller) Set(zone int, on bool) error {
+	c.mu.Lock()
+	id, ok := c.zones[zone]
+	if !ok {
+		c.mu.Unlock()
+		return fmt.Errorf("zone %d is not mapped to any relay", zone)
+	}
+	if on {
+		if err := c.policy.Allow(zone, c.active); err != nil {
+			c.mu.Unlock()
+			return err
+		}
+		c.active[zone] = true
+	} else {
+		delete(c.active, zone)
+	}
+
+	key := board{bus: id.Bus, board: id.Board}
+	r := c.boards[key]
+	var mask int
+	for z := range c.active {
+		if zid := c.zones[z]; zid.Bus == id.Bus && zid.Board == id.Board {
+			mask |= 1 << (zid.Relay - 1)
+		}
+	}
+	c.mu.Unlock()
+
+	return r.Set(mask)
+}
+
+// AllOff deactivates every zone on every board.
+func (c *Controller) AllOff() error {
+	c.mu.Lock()
+	c.active = make(map[int]bool)
+	boards := make([]*Relay, 0, len(c.boards))
+	for _, r := range c.boards {
+		boards = append(boards, r)
+	}
+	c.mu.Unlock()
+
+	var firstErr error
+	for _, r := range boards {
+		if err := r.Set(0); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Active returns the virtual zone numbers currently active.
+func (c *Controller) Active() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	zones := make([]int, 0, len(c.active))
+	for z := range c.active {
+		zones = append(zones, z)
+	}
+	return zones
+}
+
+// CheckIdle returns an error if any board opened via AddBoard reports a
+// nonzero relay mask, so a caller can detect "relays already in use" before
+// taking over a board at startup.
+func (c *Controller) CheckIdle() error {
+	c.mu.Lock()
+	boards := make(map[board]*Relay, len(c.boards))
+	for k, r := range c.boards {
+		boards[k] = r
+	}
+	c.mu.Unlock()
+
+	for key, r := range boards {
+		mask, err := r.Get()
+		if err != nil {
+			return fmt.Errorf("bus=%d board=%d: %w", key.bus, key.board, err)
+		}
+		if mask != 0 {
+			return fmt.Errorf("bus=%d board=%d: relays already in use (mask=0x%02x)", key.bus, key.board, mask)
+		}
+	}
+	return nil
+}
+
+// Close closes every board opened via AddBoard.
+func (c *Controller) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var firstErr error
+	for _, r := range c.boards {
+		if err := r.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
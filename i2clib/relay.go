@@ -16,36 +16,25 @@ const (
 )
 
 var relay2Addr = []byte{0, 2, 1, 3, 6, 4, 5, 7} // Map relay number to i2c address
-var addr2Relay []byte                           // Map i2c address to relay number
+var addr2Relay = invert(relay2Addr)             // Map i2c address to relay number
 
-// Generate inverse mapping table
-func init() {
-	addr2Relay = make([]byte, len(relay2Addr))
-	for i, v := range relay2Addr {
-		addr2Relay[v] = byte(i)
+// invert returns the inverse of permutation perm.
+func invert(perm []byte) []byte {
+	inv := make([]byte, len(perm))
+	for i, v := range perm {
+		inv[v] = byte(i)
 	}
+	return inv
 }
 
 // convert relay bit mask to i2c bit mask
 func relay2ic(in int) byte {
-	var v byte
-	for i := 0; i < 8; i++ {
-		if (in & (1 << i)) != 0 {
-			v |= 1 << relay2Addr[i]
-		}
-	}
-	return v
+	return relay2icFunc(byte(in))
 }
 
 // i2c bit mask to relay bit mask
 func ic2relay(in byte) int {
-	var v int
-	for i := 0; i < 8; i++ {
-		if (in & (1 << i)) != 0 {
-			v |= 1 << addr2Relay[i]
-		}
-	}
-	return v
+	return int(ic2relayFunc(in))
 }
 
 type Relay struct {
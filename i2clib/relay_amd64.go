@@ -0,0 +1,18 @@
+//go:build amd64
+
+package i2clib
+
+import "golang.org/x/sys/cpu"
+
+// relay2icBMI2 and ic2relayBMI2 are implemented in relay_amd64.s: they use
+// the BMI2 PDEP instruction to scatter each source bit directly to its
+// permuted destination position, without the table load in bits.go.
+func relay2icBMI2(in byte) byte
+func ic2relayBMI2(in byte) byte
+
+func init() {
+	if cpu.X86.HasBMI2 {
+		relay2icFunc = relay2icBMI2
+		ic2relayFunc = ic2relayBMI2
+	}
+}
@@ -0,0 +1,55 @@
+package i2clib
+
+import "testing"
+
+// referenceRelay2ic and referenceIc2relay are the original per-bit loop
+// implementations, kept only so the lookup-table and BMI2 fast paths can be
+// checked against them.
+func referenceRelay2ic(in int) byte {
+	var v byte
+	for i := 0; i < 8; i++ {
+		if (in & (1 << i)) != 0 {
+			v |= 1 << relay2Addr[i]
+		}
+	}
+	return v
+}
+
+func referenceIc2relay(in byte) int {
+	var v int
+	for i := 0; i < 8; i++ {
+		if (in & (1 << i)) != 0 {
+			v |= 1 << addr2Relay[i]
+		}
+	}
+	return v
+}
+
+func FuzzRelay2ic(f *testing.F) {
+	for m := 0; m < 256; m++ {
+		f.Add(byte(m))
+	}
+	f.Fuzz(func(t *testing.T, in byte) {
+		if got, want := relay2ic(int(in)), referenceRelay2ic(int(in)); got != want {
+			t.Fatalf("relay2ic(%#x) = %#x, want %#x", in, got, want)
+		}
+		if got, want := ic2relay(in), referenceIc2relay(in); got != want {
+			t.Fatalf("ic2relay(%#x) = %#x, want %#x", in, got, want)
+		}
+		if back := ic2relay(relay2ic(int(in))); back != int(in) {
+			t.Fatalf("round trip: ic2relay(relay2ic(%#x)) = %#x, want %#x", in, back, in)
+		}
+	})
+}
+
+func BenchmarkRelay2ic(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		relay2ic(i & 0xff)
+	}
+}
+
+func BenchmarkIc2relay(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ic2relay(byte(i))
+	}
+}
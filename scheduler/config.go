@@ -0,0 +1,74 @@
+// Package scheduler drives one or more named sprinkler programs on a
+// schedule, replacing the need for one cron entry per program. It reads a
+// JSON program definition file, runs programs at their configured times via
+// an i2clib.Controller, and persists enough state to a journal file to
+// resume or safely cancel a run that was interrupted by a restart.
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ZoneRun is one zone:duration step of a program. Duration is written in
+// the config file as a time.ParseDuration string (e.g. "10m"), not as a
+// raw integer of nanoseconds, to match the -program flag on the CLI.
+type ZoneRun struct {
+	Zone     int           `json:"zone"`
+	Duration time.Duration `json:"duration"`
+}
+
+func (z *ZoneRun) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Zone     int    `json:"zone"`
+		Duration string `json:"duration"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	dur, err := time.ParseDuration(raw.Duration)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", raw.Duration, err)
+	}
+	z.Zone = raw.Zone
+	z.Duration = dur
+	return nil
+}
+
+// ProgramConfig describes a single named program: the zones it runs, in
+// order, and when it should run.
+type ProgramConfig struct {
+	Zones    []ZoneRun `json:"zones"`
+	Schedule string    `json:"schedule"` // 5-field cron expression, e.g. "0 6 * * *"
+	Scale    int       `json:"scale"`    // percent, defaults to 100
+}
+
+// Config is the top-level program definition file.
+type Config struct {
+	Programs map[string]ProgramConfig `json:"programs"`
+}
+
+// LoadConfig reads and parses a program definition file. The format is
+// JSON; YAML is not currently supported since it would
+// pull in a dependency this repo doesn't otherwise need.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't read config %s: %w", path, err)
+	}
+	var c Config
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("can't parse config %s: %w", path, err)
+	}
+	for name, p := range c.Programs {
+		if _, err := parseSchedule(p.Schedule); err != nil {
+			return nil, fmt.Errorf("program %q: %w", name, err)
+		}
+		if len(p.Zones) == 0 {
+			return nil, fmt.Errorf("program %q: no zones configured", name)
+		}
+	}
+	return &c, nil
+}
@@ -0,0 +1,62 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule is a parsed 5-field cron expression: minute, hour, day of month,
+// month, day of week. Only literal values, "*", and comma-separated lists
+// are supported; no step or range syntax.
+type schedule struct {
+	minute, hour, dom, month, dow []int // nil means "*"
+}
+
+func parseSchedule(s string) (schedule, error) {
+	fields := strings.Fields(s)
+	if len(fields) != 5 {
+		return schedule{}, fmt.Errorf("invalid cron schedule %q: expecting 5 fields", s)
+	}
+	parsed := make([][]int, 5)
+	for i, f := range fields {
+		if f == "*" {
+			continue
+		}
+		for _, part := range strings.Split(f, ",") {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				return schedule{}, fmt.Errorf("invalid cron field %q: %w", f, err)
+			}
+			parsed[i] = append(parsed[i], n)
+		}
+	}
+	return schedule{
+		minute: parsed[0],
+		hour:   parsed[1],
+		dom:    parsed[2],
+		month:  parsed[3],
+		dow:    parsed[4],
+	}, nil
+}
+
+func contains(list []int, v int) bool {
+	if list == nil {
+		return true
+	}
+	for _, n := range list {
+		if n == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (s schedule) matches(t time.Time) bool {
+	return contains(s.minute, t.Minute()) &&
+		contains(s.hour, t.Hour()) &&
+		contains(s.dom, t.Day()) &&
+		contains(s.month, int(t.Month())) &&
+		contains(s.dow, int(t.Weekday()))
+}
@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// journalEntry is the persisted state for a single program.
+type journalEntry struct {
+	LastRun    time.Time `json:"last_run"`
+	LastSkip   time.Time `json:"last_skip,omitempty"`
+	InProgress bool      `json:"in_progress"`
+}
+
+// journal is a small on-disk record of per-program run state so that a
+// restart mid-program can tell a run was interrupted (InProgress was never
+// cleared) rather than mistake it for one that completed.
+type journal struct {
+	path    string
+	Entries map[string]journalEntry `json:"entries"`
+}
+
+func openJournal(path string) (*journal, error) {
+	j := &journal{path: path, Entries: make(map[string]journalEntry)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't read journal %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, j); err != nil {
+		return nil, fmt.Errorf("can't parse journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+func (j *journal) save() error {
+	data, err := json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := j.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("can't write journal %s: %w", tmp, err)
+	}
+	return os.Rename(tmp, j.path)
+}
+
+func (j *journal) markStarted(name string) error {
+	e := j.Entries[name]
+	e.InProgress = true
+	j.Entries[name] = e
+	return j.save()
+}
+
+func (j *journal) markFinished(name string, when time.Time) error {
+	e := j.Entries[name]
+	e.InProgress = false
+	e.LastRun = when
+	j.Entries[name] = e
+	return j.save()
+}
+
+func (j *journal) markSkipped(name string, when time.Time) error {
+	e := j.Entries[name]
+	e.LastSkip = when
+	j.Entries[name] = e
+	return j.save()
+}
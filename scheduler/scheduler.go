@@ -0,0 +1,215 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/thinkingcow/sprinkler-timer/i2clib"
+)
+
+// offTime mirrors the pause cmd/sprinkler leaves between zone activations.
+const offTime = time.Second * 3
+
+// Scheduler runs the named programs in a Config against a Controller at
+// their configured times. Overlapping schedules queue rather than clobber
+// each other, and a small journal on disk lets a restart tell a run was
+// interrupted rather than mistake it for one that completed.
+type Scheduler struct {
+	ctrl        *i2clib.Controller
+	configPath  string
+	journalPath string
+
+	mu     sync.Mutex
+	cfg    *Config
+	abort  chan struct{} // closed to cancel the program currently running
+	logger func(format string, args ...interface{})
+
+	queue  chan string
+	queued map[string]bool
+}
+
+// New loads configPath and returns a Scheduler ready to Run.
+func New(ctrl *i2clib.Controller, configPath, journalPath string) (*Scheduler, error) {
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	return &Scheduler{
+		ctrl:        ctrl,
+		configPath:  configPath,
+		journalPath: journalPath,
+		cfg:         cfg,
+		logger:      func(format string, args ...interface{}) { fmt.Fprintf(os.Stderr, format+"\n", args...) },
+		queue:       make(chan string, 16),
+		queued:      make(map[string]bool),
+	}, nil
+}
+
+func (s *Scheduler) config() *Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// reload re-reads configPath, swapping in the new config if it parses.
+func (s *Scheduler) reload() {
+	cfg, err := LoadConfig(s.configPath)
+	if err != nil {
+		s.logger("reload %s failed, keeping previous config: %s", s.configPath, err)
+		return
+	}
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	s.logger("reloaded %s (%d programs)", s.configPath, len(cfg.Programs))
+}
+
+// enqueue schedules name to run as soon as the executor is free. If name is
+// already queued, the new request is dropped rather than queuing twice.
+func (s *Scheduler) enqueue(name string) {
+	s.mu.Lock()
+	if s.queued[name] {
+		s.mu.Unlock()
+		s.logger("program %q already queued, skipping this trigger", name)
+		return
+	}
+	s.queued[name] = true
+	s.mu.Unlock()
+	s.queue <- name
+}
+
+// RunNow enqueues name for immediate execution, as if its schedule had
+// fired, for use by a thin CLI or HTTP client.
+func (s *Scheduler) RunNow(name string) error {
+	if _, ok := s.config().Programs[name]; !ok {
+		return fmt.Errorf("unknown program %q", name)
+	}
+	s.enqueue(name)
+	return nil
+}
+
+// Abort cancels the program currently executing, if any.
+func (s *Scheduler) Abort() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.abort == nil {
+		return false
+	}
+	close(s.abort)
+	return true
+}
+
+func (s *Scheduler) runProgram(j *journal, name string, p ProgramConfig) {
+	s.mu.Lock()
+	s.abort = make(chan struct{})
+	abort := s.abort
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.abort = nil
+		s.mu.Unlock()
+	}()
+
+	if err := j.markStarted(name); err != nil {
+		s.logger("journal: %s", err)
+	}
+	pct := p.Scale
+	if pct == 0 {
+		pct = 100
+	}
+	s.logger("running program %q", name)
+	for _, z := range p.Zones {
+		dur := time.Duration(int64(z.Duration) * int64(pct) / 100)
+		if err := s.ctrl.Set(z.Zone, true); err != nil {
+			s.logger("program %q: zone %d: %s", name, z.Zone, err)
+			break
+		}
+		select {
+		case <-time.After(dur):
+		case <-abort:
+			s.logger("program %q aborted", name)
+			s.ctrl.Set(z.Zone, false)
+			return
+		}
+		s.ctrl.Set(z.Zone, false)
+		time.Sleep(offTime)
+	}
+	if err := j.markFinished(name, time.Now()); err != nil {
+		s.logger("journal: %s", err)
+	}
+}
+
+// executor drains the run queue one program at a time, so overlapping
+// schedules queue rather than clobber each other.
+func (s *Scheduler) executor(j *journal) {
+	for name := range s.queue {
+		s.mu.Lock()
+		p, ok := s.cfg.Programs[name]
+		delete(s.queued, name)
+		s.mu.Unlock()
+		if !ok {
+			continue // program was removed by a reload before it ran
+		}
+		s.runProgram(j, name, p)
+	}
+}
+
+// resume inspects the journal left by a previous instance. A program whose
+// InProgress flag was never cleared means the process died mid-run; the
+// relay state can't be trusted, so it is logged and marked skipped instead
+// of resumed.
+func (s *Scheduler) resume(j *journal) {
+	for name, e := range j.Entries {
+		if !e.InProgress {
+			continue
+		}
+		s.logger("program %q was interrupted mid-run, turning off all zones and marking skipped", name)
+		s.ctrl.AllOff()
+		j.markSkipped(name, time.Now())
+		e.InProgress = false
+		j.Entries[name] = e
+	}
+	j.save()
+}
+
+// Run loads the journal, resumes/cancels any interrupted program, then
+// blocks forever driving the schedule and listening for SIGHUP to reload
+// configPath.
+func (s *Scheduler) Run() error {
+	j, err := openJournal(s.journalPath)
+	if err != nil {
+		return err
+	}
+	s.resume(j)
+
+	go s.executor(j)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			s.reload()
+		}
+	}()
+
+	last := time.Now()
+	for {
+		time.Sleep(time.Until(last.Truncate(time.Minute).Add(time.Minute)))
+		now := time.Now()
+		cfg := s.config()
+		for name, p := range cfg.Programs {
+			sched, err := parseSchedule(p.Schedule)
+			if err != nil {
+				continue // already validated at load time; defensive only
+			}
+			if sched.matches(now) {
+				s.enqueue(name)
+			}
+		}
+		last = now
+	}
+}